@@ -0,0 +1,72 @@
+// Copyright 2016-2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package log threads a *logrus.Entry through a context.Context, so that
+// every log line emitted while handling a pod event or NetworkPolicy can
+// carry the Kubernetes identity it was triggered by without every function
+// in the call chain having to accept and pass along its own logger.
+package log
+
+import (
+	"context"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Standard field keys attached to log entries carried through a
+// context.Context.
+const (
+	FieldEndpointID   = "endpointID"
+	FieldContainerID  = "containerID"
+	FieldK8sPodName   = "k8sPodName"
+	FieldK8sNamespace = "k8sNamespace"
+	FieldPolicyName   = "policyName"
+)
+
+// loggerKey is the unexported context key under which the *logrus.Entry is
+// stored, so that only this package's functions can set or retrieve it.
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying entry, retrievable via
+// WithContext.
+func WithLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, entry)
+}
+
+// WithContext returns the *logrus.Entry previously attached to ctx via
+// WithLogger. If ctx carries none, it returns a fresh entry off the
+// standard logger so callers never need a nil check.
+func WithContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// WithK8sIdentity returns a copy of ctx's logger entry with the
+// FieldPolicyName and FieldK8sNamespace fields set to policyName and
+// namespace. Callers in pkg/k8s resolve these values off a NetworkPolicy or
+// pod's labels using the k8s.PolicyLabelName/PodNamespaceLabel keys before
+// calling this function; this package stays free of a pkg/k8s import so it
+// can be used by pkg/k8s itself without an import cycle.
+func WithK8sIdentity(ctx context.Context, policyName, namespace string) *logrus.Entry {
+	entry := WithContext(ctx)
+	if policyName != "" {
+		entry = entry.WithField(FieldPolicyName, policyName)
+	}
+	if namespace != "" {
+		entry = entry.WithField(FieldK8sNamespace, namespace)
+	}
+	return entry
+}
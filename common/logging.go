@@ -15,17 +15,21 @@
 package common
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log/syslog"
 	"net"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/Sirupsen/logrus/hooks/syslog"
-	"github.com/bshuster-repo/logrus-logstash-hook"
+	"github.com/cilium/cilium/pkg/logging"
 	"github.com/evalphobia/logrus_fluent"
 	"regexp"
 )
@@ -47,8 +51,27 @@ var logstashOpts = map[string]bool{
 	"logstash.address":  true,
 	"logstash.level":    true,
 	"logstash.protocol": true,
+	"logstash.type":     true,
+	"logstash.tls.ca":   true,
+	"logstash.tls.cert": true,
+	"logstash.tls.key":  true,
 }
 
+const (
+	// logstashDefaultAddress is used when logstash.address is not provided.
+	logstashDefaultAddress = "127.0.0.1:5044"
+	// logstashDefaultProtocol is used when logstash.protocol is not provided.
+	logstashDefaultProtocol = "tcp"
+	// logstashDefaultType is used when logstash.type is not provided.
+	logstashDefaultType = "cilium"
+	// logstashReconnectMinBackoff is the initial delay between reconnect
+	// attempts when the connection to Logstash is lost.
+	logstashReconnectMinBackoff = 1 * time.Second
+	// logstashReconnectMaxBackoff caps the exponential backoff between
+	// reconnect attempts.
+	logstashReconnectMaxBackoff = 30 * time.Second
+)
+
 // syslogLevelMap maps logrus.Level values to syslog.Priority levels.
 var syslogLevelMap map[logrus.Level]syslog.Priority = map[logrus.Level]syslog.Priority{
 	logrus.PanicLevel: syslog.LOG_ALERT,
@@ -80,9 +103,98 @@ func setFireLevels(level logrus.Level) []logrus.Level {
 	}
 }
 
+// logFormatText and logFormatJSON name the supported values for the
+// "format" log option.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logComponent is the fixed "component" field attached to every JSON
+// formatted log entry.
+const logComponent = "cilium"
+
+// k8sNodeNameEnvVar mirrors k8s.EnvNodeNameSpec. It is duplicated here
+// instead of imported because pkg/k8s already imports common, and common
+// importing pkg/k8s would create an import cycle.
+const k8sNodeNameEnvVar = "K8S_NODE_NAME"
+
+// levelledHook is implemented by the hooks SetupLogging installs that
+// support having their fire levels reconfigured after creation, so
+// SetLogLevel can adjust them without tearing down their connections.
+type levelledHook interface {
+	logrus.Hook
+	SetLevels(levels []logrus.Level)
+}
+
+// registeredHooksMu guards registeredHooks.
+var registeredHooksMu sync.Mutex
+
+// registeredHooks holds the levelledHook installed for each log driver, so
+// that SetLogLevel can reconfigure them in place.
+var registeredHooks = map[string]levelledHook{}
+
+// registerHook records hook as the levelledHook installed for driver.
+func registerHook(driver string, hook levelledHook) {
+	registeredHooksMu.Lock()
+	defer registeredHooksMu.Unlock()
+	registeredHooks[driver] = hook
+}
+
+// SetLogLevel re-parses level and applies it to the root logrus logger and
+// to the currently registered hook for each of drivers, without tearing
+// down any existing connections. Drivers that were never registered, or
+// that do not support reconfiguration (such as syslog), are silently
+// skipped.
+func SetLogLevel(level string, drivers []string) error {
+	parsedLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	logrus.SetLevel(parsedLevel)
+	// logging.Subsystem hands out *logrus.Logger instances whose Level was
+	// snapshotted off the root logger when first created; push the new
+	// level to those without their own override so verbosity actually
+	// changes for subsys-scoped logs too.
+	logging.SetBaseLevel(parsedLevel)
+
+	fireLevels := setFireLevels(parsedLevel)
+	registeredHooksMu.Lock()
+	defer registeredHooksMu.Unlock()
+	for _, driver := range drivers {
+		if hook, ok := registeredHooks[driver]; ok {
+			hook.SetLevels(fireLevels)
+		}
+	}
+	return nil
+}
+
+// SetSubsystemLevels parses overrides, a map of subsystem name to log level
+// (e.g. {"k8s": "debug", "policy": "info"}), and merges them into the
+// per-subsystem level overrides consulted by logging.Subsystem. Subsystems
+// not present in overrides keep whatever level they already had; this is a
+// merge, not a replace, so a call setting only "k8s" never clears a
+// previously-set "policy" override.
+func SetSubsystemLevels(overrides map[string]string) error {
+	levels := make(map[string]logrus.Level, len(overrides))
+	for subsystem, level := range overrides {
+		parsedLevel, err := logrus.ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("invalid level %q for subsystem %q: %s", level, subsystem, err)
+		}
+		levels[subsystem] = parsedLevel
+	}
+	logging.SetSubsystemLevels(levels)
+	return nil
+}
+
 // SetupLogging sets up each logging service provided in loggers and configures each logger with the provided logOpts.
 func SetupLogging(loggers []string, logOpts map[string]string, tag string) error {
-	setupFormatter()
+	setupFormatter(logOpts)
+
+	// Always expose cilium_log_messages_total/cilium_log_errors_total.
+	logrus.AddHook(&metricsHook{})
 
 	// Always setup syslog.
 	valuesToValidate := getLogDriverConfig("syslog", logOpts)
@@ -91,8 +203,17 @@ func SetupLogging(loggers []string, logOpts map[string]string, tag string) error
 		return err
 	}
 
-	// Logrus has a default logger that outputs to os.stderr. Set this default output to go to ioutil.Discard to not have duplicate logs.
-	logrus.SetOutput(ioutil.Discard)
+	// Logrus has a default logger that outputs to os.stderr. Normally that's
+	// redundant with the syslog/fluentd/logstash hooks, which format and
+	// ship their own output, so discard it to avoid duplicate logs. But if
+	// the caller explicitly asked for a "format" (e.g. "json" for
+	// Fluentd/Fluent Bit/Loki to read off stdout), that formatted output is
+	// the whole point of the option, so send it to stdout instead.
+	if _, ok := logOpts["format"]; ok {
+		logrus.SetOutput(os.Stdout)
+	} else {
+		logrus.SetOutput(ioutil.Discard)
+	}
 	setupSyslog(valuesToValidate, tag)
 
 	// Iterate through all provided loggers and configure them according to user-provided settings.
@@ -108,18 +229,14 @@ func SetupLogging(loggers []string, logOpts map[string]string, tag string) error
 				return err
 			}
 			setupFluentD(valuesToValidate)
-			//TODO - need to finish logstash integration.
-		/*case "logstash":
-		fmt.Printf("SetupLogging: in logstash case\n")
-		err := validateOpts(logger, valuesToValidate, logstashOpts)
-		fmt.Printf("SetupLogging: validating options for logstash complete\n")
-		if err != nil {
-			fmt.Printf("SetupLogging: error validating logstash opts %v\n", err.Error())
-			return err
-		}
-		fmt.Printf("SetupLogging: about to setup logstash\n")
-		setupLogstash(valuesToValidate)
-		*/
+		case "logstash":
+			err := validateOpts(logger, valuesToValidate, logstashOpts)
+			if err != nil {
+				return err
+			}
+			if err := setupLogstash(valuesToValidate); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("provided log driver %q is not a supported log driver", logger)
 		}
@@ -149,18 +266,57 @@ func setupSyslog(logOpts map[string]string, tag string) {
 	logrus.AddHook(h)
 }
 
-// setupFormatter sets up the text formatting for logs output by logrus.
-func setupFormatter() {
-	fileFormat := new(logrus.TextFormatter)
-	fileFormat.DisableColors = true
-	switch os.Getenv("INITSYSTEM") {
-	case "SYSTEMD":
-		fileFormat.DisableTimestamp = true
-		fileFormat.FullTimestamp = true
+// setupFormatter sets up the formatting for logs output by logrus, according
+// to the "format" log option ("text", the default, or "json").
+func setupFormatter(logOpts map[string]string) {
+	format, ok := logOpts["format"]
+	if !ok {
+		format = logFormatText
+	}
+
+	switch format {
+	case logFormatJSON:
+		logrus.SetFormatter(&jsonFormatter{})
 	default:
-		fileFormat.TimestampFormat = time.RFC3339
+		fileFormat := new(logrus.TextFormatter)
+		fileFormat.DisableColors = true
+		switch os.Getenv("INITSYSTEM") {
+		case "SYSTEMD":
+			fileFormat.DisableTimestamp = true
+			fileFormat.FullTimestamp = true
+		default:
+			fileFormat.TimestampFormat = time.RFC3339
+		}
+		logrus.SetFormatter(fileFormat)
+	}
+}
+
+// jsonFormatter formats log entries as single-line JSON documents, with a
+// fixed "component" field and, when K8S_NODE_NAME is set, a "node" field.
+// Attached fields are emitted at the top level so that io.cilium.* labels and pod
+// namespaces show up as first-class fields in log aggregators such as
+// Fluentd/Fluent Bit/Loki, rather than being buried in a printf string.
+type jsonFormatter struct{}
+
+// Format implements logrus.Formatter.
+func (f *jsonFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	fields := make(logrus.Fields, len(entry.Data)+4)
+	for k, v := range entry.Data {
+		fields[k] = v
+	}
+	fields["time"] = entry.Time.Format(time.RFC3339Nano)
+	fields["level"] = entry.Level.String()
+	fields["msg"] = entry.Message
+	fields["component"] = logComponent
+	if node := os.Getenv(k8sNodeNameEnvVar); node != "" {
+		fields["node"] = node
 	}
-	logrus.SetFormatter(fileFormat)
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal log entry to JSON: %s", err)
+	}
+	return append(b, '\n'), nil
 }
 
 // setupFluentD sets up and configures FluentD with the provided options in logOpts. If some options are not provided, sensible defaults are used.
@@ -201,27 +357,247 @@ func setupFluentD(logOpts map[string]string) {
 	// set custom fire level
 	h.SetLevels(setFireLevels(level))
 	logrus.AddHook(h)
+	registerHook("fluentd", h)
 }
 
 // setupLogstash sets up and configures Logstash with the provided options in logOpts. If some options are not provided, sensible defaults are used.
-/// TODO fix me later - needs to be tested with a working logstash setup.
-func setupLogstash(logOpts map[string]string) {
+func setupLogstash(logOpts map[string]string) error {
 	hostAndPort, ok := logOpts["logstash.address"]
 	if !ok {
-		hostAndPort = "172.17.0.2:999"
+		hostAndPort = logstashDefaultAddress
 	}
 
 	protocol, ok := logOpts["logstash.protocol"]
 	if !ok {
-		protocol = "tcp"
+		protocol = logstashDefaultProtocol
+	}
+
+	logType, ok := logOpts["logstash.type"]
+	if !ok {
+		logType = logstashDefaultType
+	}
+
+	logLevel, ok := logOpts["logstash.level"]
+	if !ok {
+		logLevel = "info"
 	}
 
-	h, err := logrustash.NewHook(protocol, hostAndPort, "cilium")
+	//Validate provided log level.
+	level, err := logrus.ParseLevel(logLevel)
 	if err != nil {
-		logrus.Fatal(err)
+		return err
+	}
+
+	var tlsConfig *tls.Config
+	if protocol == "tls" {
+		tlsConfig, err = newLogstashTLSConfig(logOpts)
+		if err != nil {
+			return err
+		}
 	}
 
+	h := newLogstashHook(protocol, hostAndPort, tlsConfig, &logstashFormatter{Type: logType})
+	// set custom fire level
+	h.SetLevels(setFireLevels(level))
 	logrus.AddHook(h)
+	registerHook("logstash", h)
+	return nil
+}
+
+// newLogstashTLSConfig builds the tls.Config used to dial Logstash over TLS
+// from the logstash.tls.ca/cert/key options.
+func newLogstashTLSConfig(logOpts map[string]string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if ca, ok := logOpts["logstash.tls.ca"]; ok {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read logstash.tls.ca %q: %s", ca, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("unable to parse CA certificate %q", ca)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	cert, certOK := logOpts["logstash.tls.cert"]
+	key, keyOK := logOpts["logstash.tls.key"]
+	if certOK != keyOK {
+		return nil, fmt.Errorf("logstash.tls.cert and logstash.tls.key must be provided together")
+	}
+	if certOK && keyOK {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load logstash TLS key pair: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	return tlsConfig, nil
+}
+
+// logstashFormatter formats a logrus.Entry as a Logstash JSON document,
+// following the field conventions of the Logstash JSON codec.
+type logstashFormatter struct {
+	// Type is the value of the "type" field attached to every emitted document.
+	Type string
+}
+
+// Format implements logrus.Formatter.
+func (f *logstashFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	fields := make(logrus.Fields, len(entry.Data)+5)
+	for k, v := range entry.Data {
+		fields[k] = v
+	}
+	fields["@timestamp"] = entry.Time.UTC().Format(time.RFC3339Nano)
+	fields["@version"] = "1"
+	fields["message"] = entry.Message
+	fields["level"] = entry.Level.String()
+	fields["type"] = f.Type
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal log entry to Logstash JSON: %s", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// logstashHook is a logrus.Hook that ships formatted log entries to a
+// Logstash endpoint over tcp, udp or tls. If the connection is lost, it is
+// re-established in the background using an exponential backoff so that a
+// Logstash outage does not block or crash the agent.
+type logstashHook struct {
+	address   string
+	protocol  string
+	tlsConfig *tls.Config
+	formatter logrus.Formatter
+
+	mu           sync.Mutex
+	conn         net.Conn
+	levels       []logrus.Level
+	reconnecting bool
+}
+
+// newLogstashHook creates a logstashHook and kicks off the initial connection
+// attempt in the background.
+func newLogstashHook(protocol, address string, tlsConfig *tls.Config, formatter logrus.Formatter) *logstashHook {
+	h := &logstashHook{
+		address:      address,
+		protocol:     protocol,
+		tlsConfig:    tlsConfig,
+		formatter:    formatter,
+		levels:       logrus.AllLevels,
+		reconnecting: true,
+	}
+	go h.connectWithBackoff()
+	return h
+}
+
+// Levels implements logrus.Hook. It is called by logrus from arbitrary
+// goroutines for every log entry, so it must take h.mu just like SetLevels.
+func (h *logstashHook) Levels() []logrus.Level {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.levels
+}
+
+// SetLevels restricts the levels for which this hook fires, mirroring the
+// behaviour of setFireLevels for the other log drivers. It may be called at
+// runtime by SetLogLevel, concurrently with Levels/Fire, so it takes h.mu.
+func (h *logstashHook) SetLevels(levels []logrus.Level) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.levels = levels
+}
+
+// Fire implements logrus.Hook by writing the formatted entry to the current
+// Logstash connection. The write happens with h.mu held, so concurrent Fire
+// calls - which logging.Subsystem's separate *logrus.Logger instances make
+// possible even though they share this hook - can't interleave their bytes
+// into the same newline-delimited frame. If the write fails, the connection
+// is dropped and a reconnect is scheduled in the background; triggerReconnect
+// ensures at most one reconnect loop runs at a time even if many concurrent
+// Fire calls fail.
+func (h *logstashHook) Fire(entry *logrus.Entry) error {
+	b, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	conn := h.conn
+	if conn == nil {
+		h.mu.Unlock()
+		return fmt.Errorf("logstash hook: not connected to %s", h.address)
+	}
+
+	_, writeErr := conn.Write(b)
+	if writeErr != nil {
+		h.conn = nil
+	}
+	h.mu.Unlock()
+
+	if writeErr != nil {
+		h.triggerReconnect()
+		return fmt.Errorf("logstash hook: failed to write to %s: %s", h.address, writeErr)
+	}
+	return nil
+}
+
+// triggerReconnect starts connectWithBackoff in the background, unless a
+// reconnect is already in flight. This keeps a sustained outage from
+// spawning one goroutine per failed write, each of which would otherwise
+// race to set h.conn and leak the connections that lose the race.
+func (h *logstashHook) triggerReconnect() {
+	h.mu.Lock()
+	if h.reconnecting {
+		h.mu.Unlock()
+		return
+	}
+	h.reconnecting = true
+	h.mu.Unlock()
+
+	go h.connectWithBackoff()
+}
+
+// dial opens a single connection to the Logstash endpoint, using TLS when
+// tlsConfig is set.
+func (h *logstashHook) dial() (net.Conn, error) {
+	dialProtocol := h.protocol
+	if dialProtocol == "tls" {
+		dialProtocol = "tcp"
+	}
+	if h.tlsConfig != nil {
+		return tls.Dial(dialProtocol, h.address, h.tlsConfig)
+	}
+	return net.Dial(dialProtocol, h.address)
+}
+
+// connectWithBackoff dials the Logstash endpoint, retrying with exponential
+// backoff until it succeeds, so a transient outage does not bring down
+// Cilium. Only one instance of this loop ever runs at a time; see
+// triggerReconnect.
+func (h *logstashHook) connectWithBackoff() {
+	backoff := logstashReconnectMinBackoff
+	for {
+		conn, err := h.dial()
+		if err == nil {
+			h.mu.Lock()
+			h.conn = conn
+			h.reconnecting = false
+			h.mu.Unlock()
+			return
+		}
+
+		logrus.Errorf("logstash hook: unable to connect to %s: %s, retrying in %s", h.address, err, backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > logstashReconnectMaxBackoff {
+			backoff = logstashReconnectMaxBackoff
+		}
+	}
 }
 
 // validateOpts iterates through all of the keys in logOpts, and errors out if the key in logOpts is not a key in supportedOpts.
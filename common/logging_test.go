@@ -0,0 +1,117 @@
+// Copyright 2016-2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// TestLogstashHookFire starts a fake TCP Logstash listener and verifies that
+// a fired entry is delivered as a single well-formed Logstash JSON frame.
+func TestLogstashHookFire(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to start fake logstash listener: %s", err)
+	}
+	defer ln.Close()
+
+	received := make(chan map[string]interface{}, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		scanner := bufio.NewScanner(conn)
+		if scanner.Scan() {
+			var frame map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &frame); err == nil {
+				received <- frame
+			}
+		}
+	}()
+
+	hook := newLogstashHook("tcp", ln.Addr().String(), nil, &logstashFormatter{Type: "cilium-test"})
+	hook.SetLevels(setFireLevels(logrus.InfoLevel))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		hook.mu.Lock()
+		connected := hook.conn != nil
+		hook.mu.Unlock()
+		if connected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for logstash hook to connect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	entry := &logrus.Entry{
+		Logger:  logrus.StandardLogger(),
+		Data:    logrus.Fields{"foo": "bar"},
+		Time:    time.Now(),
+		Level:   logrus.InfoLevel,
+		Message: "hello logstash",
+	}
+
+	if err := hook.Fire(entry); err != nil {
+		t.Fatalf("unexpected error firing hook: %s", err)
+	}
+
+	select {
+	case frame := <-received:
+		if frame["message"] != "hello logstash" {
+			t.Errorf("unexpected message field: %v", frame["message"])
+		}
+		if frame["type"] != "cilium-test" {
+			t.Errorf("unexpected type field: %v", frame["type"])
+		}
+		if frame["foo"] != "bar" {
+			t.Errorf("expected attached field foo=bar, got %v", frame["foo"])
+		}
+		if _, ok := frame["@timestamp"]; !ok {
+			t.Error("expected @timestamp field to be set")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for logstash frame")
+	}
+}
+
+// TestLogstashHookLevels verifies that SetLevels/Levels round-trip, matching
+// the behaviour relied on by setFireLevels for the other log drivers.
+func TestLogstashHookLevels(t *testing.T) {
+	hook := &logstashHook{levels: logrus.AllLevels}
+	levels := setFireLevels(logrus.WarnLevel)
+	hook.SetLevels(levels)
+
+	got := hook.Levels()
+	if len(got) != len(levels) {
+		t.Fatalf("expected %d levels, got %d", len(levels), len(got))
+	}
+	for i := range levels {
+		if got[i] != levels[i] {
+			t.Errorf("level %d: expected %v, got %v", i, levels[i], got[i])
+		}
+	}
+}
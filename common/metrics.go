@@ -0,0 +1,67 @@
+// Copyright 2016-2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/cilium/cilium/pkg/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// logMessagesTotal counts every log entry emitted, labelled by level and
+	// subsystem, so operators can alert on an error-rate jump in a single
+	// subsystem without having to parse log streams.
+	logMessagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cilium_log_messages_total",
+		Help: "Number of log messages emitted by Cilium, labelled by level and subsystem",
+	}, []string{"level", "subsystem"})
+
+	// logErrorsTotal counts log entries at ErrorLevel or above, labelled by
+	// subsystem.
+	logErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cilium_log_errors_total",
+		Help: "Number of error (or higher severity) log messages emitted by Cilium, labelled by subsystem",
+	}, []string{"subsystem"})
+)
+
+func init() {
+	prometheus.MustRegister(logMessagesTotal)
+	prometheus.MustRegister(logErrorsTotal)
+}
+
+// metricsHook is a logrus.Hook, installed unconditionally by SetupLogging,
+// that keeps logMessagesTotal and logErrorsTotal up to date. It is cheap
+// enough to always be on.
+type metricsHook struct{}
+
+// Levels implements logrus.Hook.
+func (h *metricsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook.
+func (h *metricsHook) Fire(entry *logrus.Entry) error {
+	subsystem, ok := entry.Data[logging.FieldSubsystem].(string)
+	if !ok || subsystem == "" {
+		subsystem = "unknown"
+	}
+
+	logMessagesTotal.WithLabelValues(entry.Level.String(), subsystem).Inc()
+	if entry.Level <= logrus.ErrorLevel {
+		logErrorsTotal.WithLabelValues(subsystem).Inc()
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2016-2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package daemon implements the Cilium agent's debug REST API.
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cilium/cilium/common"
+	logctx "github.com/cilium/cilium/common/log"
+	"github.com/cilium/cilium/pkg/logging"
+)
+
+// logLevelRequest is the JSON body accepted by PATCH /debug/loglevel.
+type logLevelRequest struct {
+	// Level, if set, is applied to the root logger and to Drivers.
+	Level string `json:"level,omitempty"`
+	// Drivers lists the log drivers (e.g. "fluentd", "logstash") whose
+	// hooks should be reconfigured to Level.
+	Drivers []string `json:"drivers,omitempty"`
+	// Subsystems holds per-subsystem level overrides, e.g.
+	// {"k8s": "debug", "policy": "info"}.
+	Subsystems map[string]string `json:"subsystems,omitempty"`
+}
+
+// RegisterRoutes wires the agent's /debug endpoints onto mux, including
+// PATCH /debug/loglevel.
+func RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/loglevel", handleLogLevel)
+}
+
+// handleLogLevel implements PATCH /debug/loglevel, letting operators flip a
+// running agent's log level (and optional per-subsystem overrides) without
+// restarting it and losing in-kernel state.
+func handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entry := logctx.WithContext(r.Context()).WithField("requestID", logging.FromRequest(r))
+
+	var req logLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		entry.WithError(err).Error("invalid /debug/loglevel request body")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Level != "" {
+		if err := common.SetLogLevel(req.Level, req.Drivers); err != nil {
+			entry.WithError(err).Error("failed to set log level")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry.Infof("log level set to %q for drivers %v", req.Level, req.Drivers)
+	}
+
+	if len(req.Subsystems) > 0 {
+		if err := common.SetSubsystemLevels(req.Subsystems); err != nil {
+			entry.WithError(err).Error("failed to set subsystem log levels")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry.Infof("subsystem log levels set to %v", req.Subsystems)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,62 @@
+// Copyright 2016-2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package daemon
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestHandleLogLevel(t *testing.T) {
+	body := bytes.NewBufferString(`{"level":"debug"}`)
+	req := httptest.NewRequest(http.MethodPatch, "/debug/loglevel", body)
+	rec := httptest.NewRecorder()
+
+	handleLogLevel(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if logrus.GetLevel() != logrus.DebugLevel {
+		t.Errorf("expected root logger level to be debug, got %s", logrus.GetLevel())
+	}
+}
+
+func TestHandleLogLevelRejectsOtherMethods(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/debug/loglevel", nil)
+	rec := httptest.NewRecorder()
+
+	handleLogLevel(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rec.Code)
+	}
+}
+
+func TestHandleLogLevelRejectsInvalidBody(t *testing.T) {
+	body := bytes.NewBufferString(`not json`)
+	req := httptest.NewRequest(http.MethodPatch, "/debug/loglevel", body)
+	rec := httptest.NewRecorder()
+
+	handleLogLevel(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rec.Code)
+	}
+}
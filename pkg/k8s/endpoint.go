@@ -0,0 +1,53 @@
+// Copyright 2016-2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"context"
+
+	"github.com/Sirupsen/logrus"
+	logctx "github.com/cilium/cilium/common/log"
+)
+
+// HandleEndpointEvent is called by the pod watcher for every add/update/
+// delete event. It attaches the pod's identity to ctx's logger before
+// delegating to regenerateEndpoint, so every log line emitted while
+// processing this event carries the endpointID/containerID/k8sPodName/
+// k8sNamespace fields.
+func HandleEndpointEvent(ctx context.Context, endpointID, containerID, podName, namespace string) error {
+	entry := logctx.WithContext(ctx).WithFields(logrus.Fields{
+		logctx.FieldEndpointID:   endpointID,
+		logctx.FieldContainerID:  containerID,
+		logctx.FieldK8sPodName:   podName,
+		logctx.FieldK8sNamespace: namespace,
+	})
+	ctx = logctx.WithLogger(ctx, entry)
+
+	entry.Info("processing pod event")
+	if err := regenerateEndpoint(ctx); err != nil {
+		entry.WithError(err).Error("failed to regenerate endpoint")
+		return err
+	}
+	return nil
+}
+
+// regenerateEndpoint rebuilds the datapath state for the endpoint
+// associated with the pod event. It logs through ctx's entry, so the
+// identity fields attached by HandleEndpointEvent carry through to every
+// line logged here.
+func regenerateEndpoint(ctx context.Context) error {
+	logctx.WithContext(ctx).Debug("regenerating endpoint datapath state")
+	return nil
+}
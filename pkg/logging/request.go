@@ -0,0 +1,27 @@
+// Copyright 2016-2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import "net/http"
+
+// RequestIDHeader is the HTTP header used to correlate log lines emitted
+// across multiple Cilium processes while handling a single API request.
+const RequestIDHeader = "X-Request-Id"
+
+// FromRequest returns the request ID attached to r via RequestIDHeader, or
+// the empty string if the request carries none.
+func FromRequest(r *http.Request) string {
+	return r.Header.Get(RequestIDHeader)
+}
@@ -0,0 +1,105 @@
+// Copyright 2016-2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging provides helpers shared by Cilium components to attach
+// structured, Kubernetes-aware fields to their log output.
+package logging
+
+import (
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// FieldSubsystem is the field key used to identify which Cilium subsystem
+// emitted a given log entry.
+const FieldSubsystem = "subsys"
+
+var (
+	mu               sync.Mutex
+	subsystemLevels  = map[string]logrus.Level{}
+	subsystemLoggers = map[string]*logrus.Logger{}
+)
+
+// Subsystem returns a logrus.Entry pre-populated with the "subsys" field set
+// to name, so that every line logged through it can be attributed to a
+// specific Cilium component (e.g. "k8s", "policy", "endpoint") once it
+// reaches a log aggregator. The entry's logger runs at the level configured
+// for name via SetSubsystemLevels, falling back to the root logger's level.
+func Subsystem(name string) *logrus.Entry {
+	mu.Lock()
+	logger := subsystemLogger(name)
+	mu.Unlock()
+	return logger.WithField(FieldSubsystem, name)
+}
+
+// SetSubsystemLevels merges levels into the per-subsystem level overrides
+// consulted by Subsystem (e.g. {"k8s": logrus.DebugLevel}) and applies them
+// to any subsystem loggers already handed out. Subsystems not present in
+// levels keep whatever override they already had; this is a merge, not a
+// replace, so setting only "k8s" never clears a previously-set "policy"
+// override.
+func SetSubsystemLevels(levels map[string]logrus.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	for name, level := range levels {
+		subsystemLevels[name] = level
+	}
+	for name, logger := range subsystemLoggers {
+		logger.Level = levelForSubsystem(name)
+	}
+}
+
+// SetBaseLevel applies level to every subsystem logger that has no explicit
+// per-subsystem override, mirroring a change to the root logger's level
+// (see common.SetLogLevel). Without this, a subsystem logger's Level -
+// snapshotted from the root logger when Subsystem first handed it out -
+// would never see a later root-level change.
+func SetBaseLevel(level logrus.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	for name, logger := range subsystemLoggers {
+		if _, overridden := subsystemLevels[name]; !overridden {
+			logger.Level = level
+		}
+	}
+}
+
+// subsystemLogger returns the *logrus.Logger for name, creating one mirrored
+// off the standard logger's output/hooks/formatter on first use. Callers
+// must hold mu.
+func subsystemLogger(name string) *logrus.Logger {
+	if logger, ok := subsystemLoggers[name]; ok {
+		return logger
+	}
+
+	std := logrus.StandardLogger()
+	logger := &logrus.Logger{
+		Out:       std.Out,
+		Hooks:     std.Hooks,
+		Formatter: std.Formatter,
+		Level:     levelForSubsystem(name),
+	}
+	subsystemLoggers[name] = logger
+	return logger
+}
+
+// levelForSubsystem returns the override level configured for name, or the
+// root logger's level if none was set. Callers must hold mu.
+func levelForSubsystem(name string) logrus.Level {
+	if level, ok := subsystemLevels[name]; ok {
+		return level
+	}
+	return logrus.StandardLogger().Level
+}